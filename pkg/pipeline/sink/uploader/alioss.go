@@ -0,0 +1,73 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package uploader
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+
+	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/egress/pkg/types"
+	"github.com/livekit/psrpc"
+)
+
+type aliOSSUploader struct {
+	conf   *config.StorageConfig
+	bucket *oss.Bucket
+}
+
+func newAliOSSUploader(conf *config.StorageConfig) (uploader, error) {
+	c := conf.AliOSS
+
+	client, err := oss.New(c.Endpoint, c.AccessKey, c.Secret)
+	if err != nil {
+		return nil, err
+	}
+
+	bucket, err := client.Bucket(c.Bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	return &aliOSSUploader{conf: conf, bucket: bucket}, nil
+}
+
+func (u *aliOSSUploader) upload(localFilepath, storageFilepath string, _ types.OutputType) (string, int64, string, error) {
+	stat, err := os.Stat(localFilepath)
+	if err != nil {
+		return "", 0, "", err
+	}
+
+	f, err := os.Open(localFilepath)
+	if err != nil {
+		return "", 0, "", err
+	}
+	defer f.Close()
+
+	if err = u.bucket.PutObject(storageFilepath, rateLimited(f)); err != nil {
+		return "", 0, "", psrpc.NewErrorf(psrpc.Internal, "alioss upload failed: %v", err)
+	}
+
+	location := fmt.Sprintf("https://%s.%s/%s", u.conf.AliOSS.Bucket, u.conf.AliOSS.Endpoint, storageFilepath)
+	return location, stat.Size(), "", nil
+}
+
+// delete removes the object at storageFilepath, the same key argument
+// passed to upload.
+func (u *aliOSSUploader) delete(storageFilepath string) error {
+	return u.bucket.DeleteObject(storageFilepath)
+}
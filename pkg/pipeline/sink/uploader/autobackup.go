@@ -0,0 +1,258 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package uploader
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+
+	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/egress/pkg/stats"
+	"github.com/livekit/egress/pkg/types"
+	"github.com/livekit/protocol/logger"
+)
+
+// deleter is implemented by backends that can remove a previously uploaded
+// object. It's checked with a type assertion rather than added to the
+// uploader interface, since most backends never need to delete anything
+// outside of AutoBackup's retention pruning.
+type deleter interface {
+	delete(storageFilepath string) error
+}
+
+type backedUpFile struct {
+	localName  string
+	storageKey string
+	uploadedAt time.Time
+
+	// pruned is set once retention has removed the remote copy; the entry
+	// is kept so syncOnce doesn't upload the local file again.
+	pruned bool
+}
+
+// AutoBackup periodically uploads the files in a local directory to a remote
+// backend on a cron-like schedule, so operators running with a local egress
+// sink still end up with a durable off-box copy. Each file is uploaded once,
+// the first time a sync finds it in the directory; whether the file is still
+// being written is not checked, and later changes to it are not uploaded.
+// It's only useful when the primary sink is local; when the primary already
+// uploads to a remote backend, Uploader's own backup path covers redundancy
+// instead.
+type AutoBackup struct {
+	localDir string
+	target   uploader
+	conf     *config.AutoBackupConfig
+	monitor  *stats.HandlerMonitor
+
+	cron *cron.Cron
+
+	mu     sync.Mutex
+	synced map[string]backedUpFile
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewAutoBackup starts watching localDir according to conf and returns an
+// AutoBackup that uploads new files to conf.Target. Call Close to stop it.
+func NewAutoBackup(localDir string, conf *config.AutoBackupConfig, monitor *stats.HandlerMonitor) (*AutoBackup, error) {
+	target, err := getUploader(conf.Target)
+	if err != nil {
+		return nil, err
+	}
+
+	ab := &AutoBackup{
+		localDir: localDir,
+		target:   wrapEncryption(target, conf.Target),
+		conf:     conf,
+		monitor:  monitor,
+		synced:   make(map[string]backedUpFile),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	switch {
+	case conf.Cron != "":
+		c := cron.New()
+		if _, err = c.AddFunc(conf.Cron, ab.syncOnce); err != nil {
+			return nil, err
+		}
+		ab.cron = c
+		c.Start()
+		close(ab.done)
+
+	case conf.Interval > 0:
+		go ab.runInterval()
+
+	default:
+		// OnCompletion mode: callers drive uploads via NotifyCompleted.
+		close(ab.done)
+	}
+
+	return ab, nil
+}
+
+func (ab *AutoBackup) runInterval() {
+	defer close(ab.done)
+
+	ticker := time.NewTicker(ab.conf.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			ab.syncOnce()
+		case <-ab.stop:
+			return
+		}
+	}
+}
+
+// NotifyCompleted uploads a single finished file immediately. It's meant to
+// be called by the pipeline when AutoBackup is configured with OnCompletion.
+func (ab *AutoBackup) NotifyCompleted(localFilepath string) {
+	ab.backupFile(localFilepath)
+	ab.prune()
+}
+
+// syncOnce uploads every file under localDir that hasn't been backed up yet,
+// then applies the retention policy.
+func (ab *AutoBackup) syncOnce() {
+	entries, err := os.ReadDir(ab.localDir)
+	if err != nil {
+		logger.Errorw("autobackup: failed to read local dir", err)
+		return
+	}
+
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+
+		ab.mu.Lock()
+		_, done := ab.synced[e.Name()]
+		ab.mu.Unlock()
+		if done {
+			continue
+		}
+
+		ab.backupFile(filepath.Join(ab.localDir, e.Name()))
+	}
+
+	ab.prune()
+}
+
+func (ab *AutoBackup) backupFile(localFilepath string) {
+	storageKey := filepath.Base(localFilepath)
+
+	start := time.Now()
+	_, _, _, err := ab.target.upload(localFilepath, storageKey, types.OutputType(""))
+	elapsed := time.Since(start)
+
+	if err != nil {
+		logger.Errorw("autobackup: upload failed", err, "file", localFilepath)
+		if ab.monitor != nil {
+			ab.monitor.IncScheduledBackupFailure(float64(elapsed.Milliseconds()))
+		}
+		return
+	}
+
+	if ab.monitor != nil {
+		ab.monitor.IncScheduledBackupSuccess(float64(elapsed.Milliseconds()))
+	}
+	if h, ok := ab.target.(uploadHasher); ok {
+		_, _, _ = h.takeUploadInfo(storageKey)
+	}
+
+	ab.mu.Lock()
+	ab.synced[storageKey] = backedUpFile{
+		localName:  storageKey,
+		storageKey: storageKey,
+		uploadedAt: time.Now(),
+	}
+	ab.mu.Unlock()
+}
+
+// prune enforces the configured retention policy against the remote
+// backend, if it supports deletion.
+func (ab *AutoBackup) prune() {
+	d, ok := ab.target.(deleter)
+	if !ok {
+		return
+	}
+
+	ab.mu.Lock()
+	files := make([]backedUpFile, 0, len(ab.synced))
+	for _, f := range ab.synced {
+		if !f.pruned {
+			files = append(files, f)
+		}
+	}
+	ab.mu.Unlock()
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].uploadedAt.After(files[j].uploadedAt)
+	})
+
+	toRemove := map[string]bool{}
+
+	if ab.conf.KeepLast > 0 && len(files) > ab.conf.KeepLast {
+		for _, f := range files[ab.conf.KeepLast:] {
+			toRemove[f.localName] = true
+		}
+	}
+
+	if ab.conf.KeepFor > 0 {
+		cutoff := time.Now().Add(-ab.conf.KeepFor)
+		for _, f := range files {
+			if f.uploadedAt.Before(cutoff) {
+				toRemove[f.localName] = true
+			}
+		}
+	}
+
+	ab.mu.Lock()
+	defer ab.mu.Unlock()
+	for name := range toRemove {
+		f, ok := ab.synced[name]
+		if !ok {
+			continue
+		}
+		if err := d.delete(f.storageKey); err != nil {
+			logger.Errorw("autobackup: failed to prune remote copy", err, "key", f.storageKey)
+			continue
+		}
+		f.pruned = true
+		ab.synced[name] = f
+	}
+}
+
+// Close stops the scheduled backup loop.
+func (ab *AutoBackup) Close() {
+	if ab.cron != nil {
+		ab.cron.Stop()
+	}
+	select {
+	case <-ab.stop:
+	default:
+		close(ab.stop)
+	}
+	<-ab.done
+}
@@ -0,0 +1,78 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package uploader
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+
+	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/egress/pkg/types"
+	"github.com/livekit/psrpc"
+)
+
+type azureUploader struct {
+	conf   *config.StorageConfig
+	client *azblob.Client
+}
+
+func newAzureUploader(conf *config.StorageConfig) (uploader, error) {
+	c := conf.Azure
+
+	cred, err := azblob.NewSharedKeyCredential(c.AccountName, c.AccountKey)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := azblob.NewClientWithSharedKeyCredential(
+		fmt.Sprintf("https://%s.blob.core.windows.net/", c.AccountName), cred, nil,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &azureUploader{conf: conf, client: client}, nil
+}
+
+func (u *azureUploader) upload(localFilepath, storageFilepath string, _ types.OutputType) (string, int64, string, error) {
+	stat, err := os.Stat(localFilepath)
+	if err != nil {
+		return "", 0, "", err
+	}
+
+	f, err := os.Open(localFilepath)
+	if err != nil {
+		return "", 0, "", err
+	}
+	defer f.Close()
+
+	c := u.conf.Azure
+	if _, err = u.client.UploadStream(context.Background(), c.ContainerName, storageFilepath, rateLimited(f), nil); err != nil {
+		return "", 0, "", psrpc.NewErrorf(psrpc.Internal, "azure upload failed: %v", err)
+	}
+
+	location := fmt.Sprintf("https://%s.blob.core.windows.net/%s/%s", c.AccountName, c.ContainerName, storageFilepath)
+	return location, stat.Size(), "", nil
+}
+
+// delete removes the blob at storageFilepath, the same key argument passed
+// to upload.
+func (u *azureUploader) delete(storageFilepath string) error {
+	_, err := u.client.DeleteBlob(context.Background(), u.conf.Azure.ContainerName, storageFilepath, nil)
+	return err
+}
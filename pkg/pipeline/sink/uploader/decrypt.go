@@ -0,0 +1,118 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package uploader
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"filippo.io/age"
+	"github.com/ProtonMail/go-crypto/openpgp"
+)
+
+// Decrypt reverses the encryption applied by encryptFile, writing the
+// plaintext contents of in to out. mode must be "age" or "openpgp", matching
+// config.EncryptionConfig.Mode, and key is the corresponding age identity or
+// armored OpenPGP private key. It is the egress-decrypt helper used to
+// recover recordings uploaded with client-side encryption enabled.
+func Decrypt(in, out, mode, key, passphrase string) error {
+	src, err := os.Open(in)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	var r io.Reader
+	switch mode {
+	case "openpgp":
+		r, err = openPGPDecryptReader(src, key, passphrase)
+	default:
+		r, err = ageDecryptReader(src, key, passphrase)
+	}
+	if err != nil {
+		return err
+	}
+
+	dst, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	_, err = io.Copy(dst, r)
+	return err
+}
+
+func ageDecryptReader(src io.Reader, identityStr, passphrase string) (io.Reader, error) {
+	if passphrase != "" {
+		identity, err := age.NewScryptIdentity(passphrase)
+		if err != nil {
+			return nil, err
+		}
+		return age.Decrypt(src, identity)
+	}
+
+	identity, err := age.ParseX25519Identity(identityStr)
+	if err != nil {
+		return nil, err
+	}
+
+	return age.Decrypt(src, identity)
+}
+
+func openPGPDecryptReader(src io.Reader, privateKey, passphrase string) (io.Reader, error) {
+	// Symmetric: encryptFile used openpgp.SymmetricallyEncrypt with only a
+	// passphrase, so there's no recipient key ring to read here either.
+	if privateKey == "" {
+		prompted := false
+		prompt := func(_ []openpgp.Key, _ bool) ([]byte, error) {
+			if prompted {
+				return nil, fmt.Errorf("openpgp: incorrect passphrase")
+			}
+			prompted = true
+			return []byte(passphrase), nil
+		}
+
+		md, err := openpgp.ReadMessage(src, nil, prompt, nil)
+		if err != nil {
+			return nil, err
+		}
+		return md.UnverifiedBody, nil
+	}
+
+	keyRing, err := openpgp.ReadArmoredKeyRing(strings.NewReader(privateKey))
+	if err != nil {
+		return nil, err
+	}
+
+	if passphrase != "" {
+		for _, entity := range keyRing {
+			if entity.PrivateKey != nil && entity.PrivateKey.Encrypted {
+				if err = entity.PrivateKey.Decrypt([]byte(passphrase)); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	md, err := openpgp.ReadMessage(src, keyRing, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return md.UnverifiedBody, nil
+}
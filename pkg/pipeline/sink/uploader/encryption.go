@@ -0,0 +1,232 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package uploader
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"filippo.io/age"
+	"github.com/ProtonMail/go-crypto/openpgp"
+
+	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/egress/pkg/types"
+	"github.com/livekit/psrpc"
+)
+
+const (
+	ageExtension     = ".age"
+	openPGPExtension = ".gpg"
+)
+
+// encryptedUploader wraps another uploader and streams the local file
+// through a client-side encryption writer before handing it to the wrapped
+// backend, so recordings can be stored in a third-party bucket without
+// trusting the storage provider with their contents.
+type encryptedUploader struct {
+	uploader
+	conf *config.EncryptionConfig
+
+	// mu guards results. Multiple files can be in flight through the same
+	// Uploader/encryptedUploader at once, so the checksum/size of each
+	// upload is keyed by its storageFilepath rather than held in a single
+	// shared field, which would let one call's result be overwritten by
+	// another's before recordManifestEntry reads it back.
+	mu      sync.Mutex
+	results map[string]encryptResult
+}
+
+type encryptResult struct {
+	sha256 string
+	size   int64
+}
+
+// wrapEncryption wraps next with encryption if conf.Encryption is set,
+// otherwise it returns next unchanged.
+func wrapEncryption(next uploader, conf *config.StorageConfig) uploader {
+	if conf == nil || conf.Encryption == nil {
+		return next
+	}
+
+	return &encryptedUploader{uploader: next, conf: conf.Encryption}
+}
+
+func (u *encryptedUploader) upload(localFilepath, storageFilepath string, outputType types.OutputType) (string, int64, string, error) {
+	ext := encryptionExtension(u.conf)
+	encryptedPath := localFilepath + ext
+
+	sum, size, err := encryptFile(localFilepath, encryptedPath, u.conf)
+	if err != nil {
+		return "", 0, "", psrpc.NewErrorf(psrpc.Internal, "encryption failed: %v", err)
+	}
+	defer os.Remove(encryptedPath)
+
+	u.mu.Lock()
+	if u.results == nil {
+		u.results = make(map[string]encryptResult)
+	}
+	u.results[storageFilepath] = encryptResult{sha256: sum, size: size}
+	u.mu.Unlock()
+
+	location, uploadedSize, presignedURL, err := u.uploader.upload(encryptedPath, storageFilepath+ext, outputType)
+	if err != nil {
+		u.mu.Lock()
+		delete(u.results, storageFilepath)
+		u.mu.Unlock()
+	}
+	return location, uploadedSize, presignedURL, err
+}
+
+// takeUploadInfo returns the checksum and size of the ciphertext handed to
+// the wrapped backend for the upload keyed by storageFilepath (the same
+// value passed as upload's second argument), and removes it — each result
+// is meant to be consumed exactly once, by the recordManifestEntry call that
+// follows its upload. Callers that need to verify integrity (e.g. the
+// manifest) use this instead of hashing the plaintext original, which no
+// longer matches what's actually stored remotely.
+func (u *encryptedUploader) takeUploadInfo(storageFilepath string) (string, int64, bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	r, ok := u.results[storageFilepath]
+	if ok {
+		delete(u.results, storageFilepath)
+	}
+	return r.sha256, r.size, ok
+}
+
+// delete removes the encrypted object matching storageFilepath, delegating
+// to the wrapped backend if it supports deletion.
+func (u *encryptedUploader) delete(storageFilepath string) error {
+	d, ok := u.uploader.(deleter)
+	if !ok {
+		return psrpc.NewErrorf(psrpc.Unimplemented, "backend does not support delete")
+	}
+	return d.delete(storageFilepath + encryptionExtension(u.conf))
+}
+
+func encryptionExtension(conf *config.EncryptionConfig) string {
+	if conf.Mode == "openpgp" {
+		return openPGPExtension
+	}
+	return ageExtension
+}
+
+// encryptFile writes the encrypted contents of in to out and returns the
+// SHA256 checksum and size of the ciphertext actually written, so callers
+// can record what was produced rather than re-deriving it from the
+// plaintext original afterward.
+func encryptFile(in, out string, conf *config.EncryptionConfig) (string, int64, error) {
+	src, err := os.Open(in)
+	if err != nil {
+		return "", 0, err
+	}
+	defer src.Close()
+
+	dst, err := os.Create(out)
+	if err != nil {
+		return "", 0, err
+	}
+	defer dst.Close()
+
+	hw := &hashingWriter{w: dst, h: sha256.New()}
+
+	var w io.WriteCloser
+	switch conf.Mode {
+	case "openpgp":
+		w, err = newOpenPGPWriter(hw, conf)
+	default:
+		w, err = newAgeWriter(hw, conf)
+	}
+	if err != nil {
+		return "", 0, err
+	}
+
+	if _, err = io.Copy(w, src); err != nil {
+		_ = w.Close()
+		return "", 0, err
+	}
+
+	if err = w.Close(); err != nil {
+		return "", 0, err
+	}
+
+	return hex.EncodeToString(hw.h.Sum(nil)), hw.size, nil
+}
+
+// hashingWriter tees everything written to it through a SHA256 hash while
+// tracking the total byte count, so the checksum of an encrypted stream can
+// be computed without a second read pass over the ciphertext.
+type hashingWriter struct {
+	w    io.Writer
+	h    hash.Hash
+	size int64
+}
+
+func (hw *hashingWriter) Write(p []byte) (int, error) {
+	n, err := hw.w.Write(p)
+	if n > 0 {
+		hw.h.Write(p[:n])
+		hw.size += int64(n)
+	}
+	return n, err
+}
+
+func newAgeWriter(dst io.Writer, conf *config.EncryptionConfig) (io.WriteCloser, error) {
+	if conf.Passphrase != "" {
+		recipient, err := age.NewScryptRecipient(conf.Passphrase)
+		if err != nil {
+			return nil, err
+		}
+		return age.Encrypt(dst, recipient)
+	}
+
+	recipients := make([]age.Recipient, 0, len(conf.Recipients))
+	for _, r := range conf.Recipients {
+		recipient, err := age.ParseX25519Recipient(r)
+		if err != nil {
+			return nil, err
+		}
+		recipients = append(recipients, recipient)
+	}
+
+	return age.Encrypt(dst, recipients...)
+}
+
+func newOpenPGPWriter(dst io.Writer, conf *config.EncryptionConfig) (io.WriteCloser, error) {
+	if len(conf.Recipients) == 0 {
+		if conf.Passphrase == "" {
+			return nil, fmt.Errorf("openpgp: either Recipients or Passphrase must be set")
+		}
+		return openpgp.SymmetricallyEncrypt(dst, []byte(conf.Passphrase), nil, nil)
+	}
+
+	var entities openpgp.EntityList
+	for _, r := range conf.Recipients {
+		keyRing, err := openpgp.ReadArmoredKeyRing(strings.NewReader(r))
+		if err != nil {
+			return nil, err
+		}
+		entities = append(entities, keyRing...)
+	}
+
+	return openpgp.Encrypt(dst, entities, nil, nil, nil)
+}
@@ -0,0 +1,146 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package uploader
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+
+	"github.com/livekit/egress/pkg/config"
+)
+
+const plaintext = "the quick brown fox jumps over the lazy dog"
+
+func TestEncryptDecryptRoundTripAgePassphrase(t *testing.T) {
+	testEncryptDecryptRoundTrip(t, &config.EncryptionConfig{
+		Mode:       "age",
+		Passphrase: "correct-horse-battery-staple",
+	}, "")
+}
+
+func TestEncryptDecryptRoundTripOpenPGPPassphrase(t *testing.T) {
+	testEncryptDecryptRoundTrip(t, &config.EncryptionConfig{
+		Mode:       "openpgp",
+		Passphrase: "correct-horse-battery-staple",
+	}, "")
+}
+
+// TestEncryptDecryptRoundTripAgeRecipient covers the recipient-public-key
+// path real operators use for one-way encryption with no shared secret, as
+// opposed to the passphrase path covered above.
+func TestEncryptDecryptRoundTripAgeRecipient(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("GenerateX25519Identity: %v", err)
+	}
+
+	testEncryptDecryptRoundTrip(t, &config.EncryptionConfig{
+		Mode:       "age",
+		Recipients: []string{identity.Recipient().String()},
+	}, identity.String())
+}
+
+// TestEncryptDecryptRoundTripOpenPGPRecipient covers newOpenPGPWriter's
+// recipient branch, the mode real operators use for one-way encryption with
+// no shared secret, as opposed to the passphrase path covered above.
+func TestEncryptDecryptRoundTripOpenPGPRecipient(t *testing.T) {
+	entity, err := openpgp.NewEntity("Test User", "", "test@example.com", nil)
+	if err != nil {
+		t.Fatalf("NewEntity: %v", err)
+	}
+
+	pubKey := armorKey(t, openpgp.PublicKeyType, entity.Serialize)
+	privKey := armorKey(t, openpgp.PrivateKeyType, func(w io.Writer) error {
+		return entity.SerializePrivate(w, nil)
+	})
+
+	testEncryptDecryptRoundTrip(t, &config.EncryptionConfig{
+		Mode:       "openpgp",
+		Recipients: []string{pubKey},
+	}, privKey)
+}
+
+func armorKey(t *testing.T, blockType string, serialize func(io.Writer) error) string {
+	var buf bytes.Buffer
+
+	w, err := armor.Encode(&buf, blockType, nil)
+	if err != nil {
+		t.Fatalf("armor.Encode: %v", err)
+	}
+	if err = serialize(w); err != nil {
+		t.Fatalf("serialize: %v", err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatalf("close armor writer: %v", err)
+	}
+
+	return buf.String()
+}
+
+// testEncryptDecryptRoundTrip encrypts and decrypts plaintext using conf,
+// decrypting with decryptKey (an age identity or armored OpenPGP private
+// key) when set, or conf.Passphrase otherwise.
+func testEncryptDecryptRoundTrip(t *testing.T, conf *config.EncryptionConfig, decryptKey string) {
+	dir := t.TempDir()
+	in := filepath.Join(dir, "plain.txt")
+	encrypted := filepath.Join(dir, "plain.txt"+encryptionExtension(conf))
+	out := filepath.Join(dir, "roundtrip.txt")
+
+	if err := os.WriteFile(in, []byte(plaintext), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	sum, size, err := encryptFile(in, encrypted, conf)
+	if err != nil {
+		t.Fatalf("encryptFile: %v", err)
+	}
+	if sum == "" {
+		t.Fatal("encryptFile returned empty checksum")
+	}
+
+	stat, err := os.Stat(encrypted)
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if size != stat.Size() {
+		t.Errorf("encryptFile size = %d, want %d", size, stat.Size())
+	}
+
+	if err = Decrypt(encrypted, out, conf.Mode, decryptKey, conf.Passphrase); err != nil {
+		t.Fatalf("Decrypt: %v", err)
+	}
+
+	got, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if string(got) != plaintext {
+		t.Errorf("round trip mismatch: got %q, want %q", got, plaintext)
+	}
+}
+
+func TestOpenPGPWriterRejectsNoRecipientsOrPassphrase(t *testing.T) {
+	_, err := newOpenPGPWriter(nil, &config.EncryptionConfig{Mode: "openpgp"})
+	if err == nil {
+		t.Fatal("expected error when neither Recipients nor Passphrase are set")
+	}
+}
@@ -0,0 +1,269 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package uploader
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+
+	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/egress/pkg/types"
+	"github.com/livekit/protocol/logger"
+	"github.com/livekit/psrpc"
+)
+
+const gcsUploadScope = "https://www.googleapis.com/auth/devstorage.read_write"
+
+type gcpUploader struct {
+	conf   *config.StorageConfig
+	client *http.Client
+}
+
+func newGCPUploader(conf *config.StorageConfig) (uploader, error) {
+	ctx := context.Background()
+
+	var creds *google.Credentials
+	var err error
+	if len(conf.GCP.CredentialsJSON) > 0 {
+		creds, err = google.CredentialsFromJSON(ctx, []byte(conf.GCP.CredentialsJSON), gcsUploadScope)
+	} else {
+		creds, err = google.FindDefaultCredentials(ctx, gcsUploadScope)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &gcpUploader{conf: conf, client: oauth2.NewClient(ctx, creds.TokenSource)}, nil
+}
+
+func (u *gcpUploader) upload(localFilepath, storageFilepath string, _ types.OutputType) (string, int64, string, error) {
+	stat, err := os.Stat(localFilepath)
+	if err != nil {
+		return "", 0, "", err
+	}
+
+	bucket := u.conf.GCP.Bucket
+	mpConf := u.conf.Multipart
+	if mpConf != nil {
+		mpConf = normalizeMultipartConfig(mpConf)
+	}
+
+	if mpConf != nil && stat.Size() >= mpConf.Threshold {
+		if err = u.uploadResumable(localFilepath, bucket, storageFilepath, stat.Size(), mpConf); err != nil {
+			return "", 0, "", psrpc.NewErrorf(psrpc.Internal, "gcs resumable upload failed: %v", err)
+		}
+	} else {
+		f, err := os.Open(localFilepath)
+		if err != nil {
+			return "", 0, "", err
+		}
+		defer f.Close()
+
+		if err = u.putObject(bucket, storageFilepath, rateLimited(f), stat.Size()); err != nil {
+			return "", 0, "", psrpc.NewErrorf(psrpc.Internal, "gcs upload failed: %v", err)
+		}
+	}
+
+	return fmt.Sprintf("https://storage.googleapis.com/%s/%s", bucket, storageFilepath), stat.Size(), "", nil
+}
+
+// delete removes the object at storageFilepath, the same key argument
+// passed to upload.
+func (u *gcpUploader) delete(storageFilepath string) error {
+	url := fmt.Sprintf("https://storage.googleapis.com/storage/v1/b/%s/o/%s", u.conf.GCP.Bucket, storageFilepath)
+	req, err := http.NewRequest(http.MethodDelete, url, nil)
+	if err != nil {
+		return err
+	}
+
+	res, err := u.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 && res.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("gcs returned status %d deleting object", res.StatusCode)
+	}
+
+	return nil
+}
+
+func (u *gcpUploader) putObject(bucket, key string, body io.Reader, size int64) error {
+	url := fmt.Sprintf("https://storage.googleapis.com/upload/storage/v1/b/%s/o?uploadType=media&name=%s", bucket, key)
+	req, err := http.NewRequest(http.MethodPost, url, body)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+
+	res, err := u.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("gcs returned status %d", res.StatusCode)
+	}
+
+	return nil
+}
+
+// uploadResumable drives the GCS resumable upload protocol directly, storing
+// the resumable session URI in the on-disk journal so that a crash mid-upload
+// can re-query the backend for the last received byte and pick back up from
+// there instead of resending the whole file.
+func (u *gcpUploader) uploadResumable(localFilepath, bucket, key string, size int64, mpConf *config.MultipartConfig) error {
+	journalFile := journalPath(mpConf.ResumeStatePath, bucket, key)
+	journal, resuming := loadMultipartJournal(journalFile)
+
+	if !resuming {
+		sessionURI, err := u.startResumableSession(bucket, key)
+		if err != nil {
+			return err
+		}
+
+		journal = &multipartJournal{
+			Path:     journalFile,
+			UploadID: sessionURI,
+			Bucket:   bucket,
+			Key:      key,
+			PartSize: mpConf.PartSize,
+			ETags:    make(map[int32]string),
+		}
+		if err = journal.save(); err != nil {
+			return err
+		}
+	} else {
+		logger.Infow("resuming gcs resumable upload", "key", key)
+	}
+
+	f, err := os.Open(localFilepath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	offset, err := u.queryResumeOffset(journal.UploadID, size)
+	if err != nil {
+		return err
+	}
+
+	for offset < size {
+		end := offset + journal.PartSize
+		if end > size {
+			end = size
+		}
+
+		buf := make([]byte, end-offset)
+		if _, err = f.ReadAt(buf, offset); err != nil {
+			return err
+		}
+
+		if err = throttle(context.Background(), len(buf)); err != nil {
+			return err
+		}
+		if err = u.putChunk(journal.UploadID, buf, offset, size); err != nil {
+			return err
+		}
+
+		offset = end
+		journal.ETags[int32(offset/journal.PartSize)] = "ok"
+		_ = journal.save()
+	}
+
+	journal.remove()
+	return nil
+}
+
+func (u *gcpUploader) startResumableSession(bucket, key string) (string, error) {
+	url := fmt.Sprintf("https://storage.googleapis.com/upload/storage/v1/b/%s/o?uploadType=resumable&name=%s", bucket, key)
+	req, err := http.NewRequest(http.MethodPost, url, nil)
+	if err != nil {
+		return "", err
+	}
+
+	res, err := u.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		return "", fmt.Errorf("gcs returned status %d starting resumable session", res.StatusCode)
+	}
+
+	return res.Header.Get("Location"), nil
+}
+
+func (u *gcpUploader) queryResumeOffset(sessionURI string, size int64) (int64, error) {
+	req, err := http.NewRequest(http.MethodPut, sessionURI, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+
+	res, err := u.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	switch {
+	case res.StatusCode == http.StatusOK || res.StatusCode == http.StatusCreated:
+		return size, nil
+	case res.StatusCode == 308:
+		rangeHdr := res.Header.Get("Range")
+		if rangeHdr == "" {
+			return 0, nil
+		}
+		var lo, hi int64
+		if _, err = fmt.Sscanf(rangeHdr, "bytes=%d-%d", &lo, &hi); err != nil {
+			return 0, err
+		}
+		return hi + 1, nil
+	default:
+		return 0, fmt.Errorf("gcs returned status %d querying resume offset", res.StatusCode)
+	}
+}
+
+func (u *gcpUploader) putChunk(sessionURI string, chunk []byte, offset, total int64) error {
+	req, err := http.NewRequest(http.MethodPut, sessionURI, bytes.NewReader(chunk))
+	if err != nil {
+		return err
+	}
+	req.ContentLength = int64(len(chunk))
+	req.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, offset+int64(len(chunk))-1, total))
+
+	res, err := u.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != 308 && res.StatusCode != http.StatusOK && res.StatusCode != http.StatusCreated {
+		return fmt.Errorf("gcs returned status %d uploading chunk", res.StatusCode)
+	}
+
+	return nil
+}
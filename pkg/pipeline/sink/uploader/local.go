@@ -0,0 +1,71 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package uploader
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/egress/pkg/types"
+)
+
+type localUploader struct {
+	conf *config.StorageConfig
+}
+
+func newLocalUploader(conf *config.StorageConfig) (uploader, error) {
+	return &localUploader{conf: conf}, nil
+}
+
+func (u *localUploader) upload(localFilepath, storageFilepath string, _ types.OutputType) (string, int64, string, error) {
+	stat, err := os.Stat(localFilepath)
+	if err != nil {
+		return "", 0, "", err
+	}
+
+	if localFilepath == storageFilepath {
+		return storageFilepath, stat.Size(), "", nil
+	}
+
+	if err = os.MkdirAll(filepath.Dir(storageFilepath), 0755); err != nil {
+		return "", 0, "", err
+	}
+
+	in, err := os.Open(localFilepath)
+	if err != nil {
+		return "", 0, "", err
+	}
+	defer in.Close()
+
+	out, err := os.Create(storageFilepath)
+	if err != nil {
+		return "", 0, "", err
+	}
+	defer out.Close()
+
+	if _, err = io.Copy(out, rateLimited(in)); err != nil {
+		return "", 0, "", err
+	}
+
+	return storageFilepath, stat.Size(), "", nil
+}
+
+// delete removes the file at storageFilepath, the same path argument passed
+// to upload.
+func (u *localUploader) delete(storageFilepath string) error {
+	return os.Remove(storageFilepath)
+}
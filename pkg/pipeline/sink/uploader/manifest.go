@@ -0,0 +1,192 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package uploader
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/livekit/egress/pkg/types"
+	"github.com/livekit/psrpc"
+)
+
+// ManifestEncryption records which client-side encryption, if any, was
+// applied to a manifest entry's artifact.
+type ManifestEncryption struct {
+	Mode       string   `json:"mode"`
+	Recipients []string `json:"recipients,omitempty"`
+}
+
+// ManifestEntry describes a single uploaded artifact: where it ended up,
+// its size and checksum, and which backend wrote it, so a downstream
+// consumer can verify integrity without trusting the bucket listing.
+type ManifestEntry struct {
+	RemoteURL   string              `json:"remoteUrl"`
+	Size        int64               `json:"size"`
+	SHA256      string              `json:"sha256"`
+	ContentType string              `json:"contentType"`
+	Backend     string              `json:"backend"`
+	UploadedAt  time.Time           `json:"uploadedAt"`
+	Encryption  *ManifestEncryption `json:"encryption,omitempty"`
+}
+
+// Manifest lists every artifact uploaded for a single egress. It's uploaded
+// as a sibling object so a downstream consumer can locate and verify all
+// segments of a recording from one well-known object.
+type Manifest struct {
+	Files     []ManifestEntry `json:"files"`
+	Signature string          `json:"signature,omitempty"`
+}
+
+// uploadHasher is implemented by uploaders that transform the local file
+// before handing it to a backend (currently encryptedUploader), so the
+// checksum recorded in the manifest matches what's actually stored remotely
+// rather than the original, pre-transform, local file. Results are keyed by
+// storageFilepath since multiple uploads can be in flight through the same
+// uploader at once.
+type uploadHasher interface {
+	takeUploadInfo(storageFilepath string) (sha256 string, size int64, ok bool)
+}
+
+// recordManifestEntry appends a manifest entry describing the bytes most
+// recently handed to up for storageFilepath. If up transformed localFilepath
+// (e.g. encryption) and exposes uploadHasher, the checksum/size of the
+// transformed bytes are used; otherwise localFilepath is hashed directly,
+// since in that case it's exactly what was uploaded. It must be called
+// before the local file is removed.
+func (u *Uploader) recordManifestEntry(localFilepath, storageFilepath, remoteURL, backend string, up uploader) error {
+	var (
+		sum  string
+		size int64
+	)
+
+	if h, ok := up.(uploadHasher); ok {
+		sum, size, ok = h.takeUploadInfo(storageFilepath)
+		if !ok {
+			return psrpc.NewErrorf(psrpc.Internal, "missing upload checksum for %s", remoteURL)
+		}
+	} else {
+		stat, err := os.Stat(localFilepath)
+		if err != nil {
+			return err
+		}
+		size = stat.Size()
+
+		sum, err = sha256File(localFilepath)
+		if err != nil {
+			return err
+		}
+	}
+
+	entry := ManifestEntry{
+		RemoteURL:   remoteURL,
+		Size:        size,
+		SHA256:      sum,
+		ContentType: contentTypeFromExt(localFilepath),
+		Backend:     backend,
+		UploadedAt:  time.Now(),
+		Encryption:  u.encryptionInfo,
+	}
+
+	u.manifestMu.Lock()
+	u.manifest.Files = append(u.manifest.Files, entry)
+	u.manifestMu.Unlock()
+
+	return nil
+}
+
+func sha256File(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func contentTypeFromExt(path string) string {
+	if ct := mime.TypeByExtension(filepath.Ext(path)); ct != "" {
+		return ct
+	}
+	return "application/octet-stream"
+}
+
+// Manifest returns a snapshot of every artifact uploaded so far, signed with
+// the configured SigningKey if one was set.
+func (u *Uploader) Manifest() (*Manifest, error) {
+	u.manifestMu.Lock()
+	m := &Manifest{Files: append([]ManifestEntry(nil), u.manifest.Files...)}
+	u.manifestMu.Unlock()
+
+	if u.signingKey != nil {
+		payload, err := json.Marshal(m.Files)
+		if err != nil {
+			return nil, err
+		}
+		m.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(u.signingKey, payload))
+	}
+
+	return m, nil
+}
+
+// UploadManifest marshals the current manifest and uploads it as a sibling
+// object named storageFilepath.
+func (u *Uploader) UploadManifest(storageFilepath string) (string, error) {
+	m, err := u.Manifest()
+	if err != nil {
+		return "", err
+	}
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	tmp, err := os.CreateTemp("", "egress-manifest-*.json")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return "", err
+	}
+	if err = tmp.Close(); err != nil {
+		return "", err
+	}
+
+	target := u.primary
+	if enc, ok := target.(*encryptedUploader); ok {
+		target = enc.uploader
+	}
+
+	location, _, _, err := target.upload(tmp.Name(), storageFilepath, types.OutputType(""))
+	return location, err
+}
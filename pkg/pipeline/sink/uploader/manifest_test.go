@@ -0,0 +1,129 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package uploader
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/egress/pkg/types"
+)
+
+type fakeUploader struct {
+	location string
+}
+
+func (f *fakeUploader) upload(localFilepath, storageFilepath string, _ types.OutputType) (string, int64, string, error) {
+	return f.location, 0, "", nil
+}
+
+func TestManifestSignatureVerifiesAgainstPublicKey(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+
+	u := &Uploader{primary: &fakeUploader{location: "https://example/room.mp4"}, signingKey: priv}
+
+	path := filepath.Join(t.TempDir(), "room.mp4")
+	if err := os.WriteFile(path, []byte("recording"), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	if err := u.recordManifestEntry(path, "room.mp4", "https://example/room.mp4", "primary", u.primary); err != nil {
+		t.Fatalf("recordManifestEntry: %v", err)
+	}
+
+	m, err := u.Manifest()
+	if err != nil {
+		t.Fatalf("Manifest: %v", err)
+	}
+	if len(m.Files) != 1 {
+		t.Fatalf("len(Files) = %d, want 1", len(m.Files))
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(m.Signature)
+	if err != nil {
+		t.Fatalf("decode signature: %v", err)
+	}
+
+	payload, err := json.Marshal(m.Files)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+
+	if !ed25519.Verify(pub, payload, sig) {
+		t.Error("signature does not verify against the manifest's public key")
+	}
+}
+
+func TestManifestEntryHashesEncryptedBytesWhenWrapped(t *testing.T) {
+	u := &Uploader{primary: &fakeUploader{location: "https://example/room.mp4.age"}}
+
+	enc := &encryptedUploader{uploader: u.primary, conf: &config.EncryptionConfig{Mode: "age"}}
+	enc.results = map[string]encryptResult{"room.mp4": {sha256: "deadbeef", size: 42}}
+
+	path := filepath.Join(t.TempDir(), "room.mp4")
+	if err := os.WriteFile(path, []byte("plaintext, not what's stored remotely"), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	if err := u.recordManifestEntry(path, "room.mp4", "https://example/room.mp4.age", "primary", enc); err != nil {
+		t.Fatalf("recordManifestEntry: %v", err)
+	}
+
+	entry := u.manifest.Files[0]
+	if entry.SHA256 != "deadbeef" {
+		t.Errorf("SHA256 = %q, want %q (the ciphertext checksum, not the plaintext's)", entry.SHA256, "deadbeef")
+	}
+	if entry.Size != 42 {
+		t.Errorf("Size = %d, want %d", entry.Size, 42)
+	}
+}
+
+// TestEncryptedUploaderResultsAreKeyedPerCall guards against the two
+// concurrent uploads through one encryptedUploader clobbering each other's
+// recorded checksum: storing the result in a single shared field (rather
+// than keyed by storageFilepath) would let whichever call finishes last win
+// for both, silently corrupting the manifest.
+func TestEncryptedUploaderResultsAreKeyedPerCall(t *testing.T) {
+	enc := &encryptedUploader{conf: &config.EncryptionConfig{Mode: "age"}}
+
+	enc.mu.Lock()
+	enc.results = map[string]encryptResult{
+		"room-a.mp4": {sha256: "aaaa", size: 1},
+		"room-b.mp4": {sha256: "bbbb", size: 2},
+	}
+	enc.mu.Unlock()
+
+	sumA, sizeA, ok := enc.takeUploadInfo("room-a.mp4")
+	if !ok || sumA != "aaaa" || sizeA != 1 {
+		t.Errorf("room-a.mp4: got (%q, %d, %v), want (%q, %d, true)", sumA, sizeA, ok, "aaaa", 1)
+	}
+
+	sumB, sizeB, ok := enc.takeUploadInfo("room-b.mp4")
+	if !ok || sumB != "bbbb" || sizeB != 2 {
+		t.Errorf("room-b.mp4: got (%q, %d, %v), want (%q, %d, true)", sumB, sizeB, ok, "bbbb", 2)
+	}
+
+	if _, _, ok := enc.takeUploadInfo("room-a.mp4"); ok {
+		t.Error("expected result to be consumed after the first takeUploadInfo call")
+	}
+}
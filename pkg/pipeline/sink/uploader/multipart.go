@@ -0,0 +1,114 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package uploader
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/livekit/egress/pkg/config"
+)
+
+const (
+	// minPartSize is S3's minimum multipart part size; GCS's resumable
+	// upload chunk size must also be a multiple of 256KiB, so flooring at
+	// the same value keeps one constant doing double duty.
+	minPartSize = 5 << 20 // 5MiB
+
+	// defaultMultipartThreshold is used when Threshold is left at its zero
+	// value, so enabling Multipart without setting Threshold doesn't route
+	// every file, however small, through the multipart path.
+	defaultMultipartThreshold = 16 << 20 // 16MiB
+)
+
+// normalizeMultipartConfig returns a copy of mpConf with PartSize and
+// Threshold clamped to sane floors. PartSize backs a divisor when computing
+// part counts, so a zero value (the default for an unconfigured
+// MultipartConfig) would panic; Threshold left unset would otherwise send
+// every upload, however small, through the multipart path.
+func normalizeMultipartConfig(mpConf *config.MultipartConfig) *config.MultipartConfig {
+	normalized := *mpConf
+	if normalized.PartSize < minPartSize {
+		normalized.PartSize = minPartSize
+	}
+	if normalized.Threshold <= 0 {
+		normalized.Threshold = defaultMultipartThreshold
+	}
+	return &normalized
+}
+
+// multipartJournal persists the state of an in-progress multipart/resumable
+// upload (the remote upload id/session and the parts already acknowledged by
+// the backend) so that a crash or restart can resume the upload instead of
+// sending the whole file again.
+type multipartJournal struct {
+	Path string `json:"-"`
+
+	// UploadID holds the backend's handle for the in-progress upload: an S3
+	// multipart upload id, or a GCS resumable session URI.
+	UploadID string `json:"uploadId"`
+	Bucket   string `json:"bucket"`
+	Key      string `json:"key"`
+	PartSize int64  `json:"partSize"`
+
+	// ETags maps part number to the backend-assigned identifier for that
+	// part. A part present here is considered durably uploaded.
+	ETags map[int32]string `json:"etags"`
+}
+
+func loadMultipartJournal(path string) (*multipartJournal, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+
+	j := &multipartJournal{Path: path}
+	if err = json.Unmarshal(data, j); err != nil {
+		return nil, false
+	}
+
+	return j, true
+}
+
+func (j *multipartJournal) save() error {
+	data, err := json.Marshal(j)
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(j.Path), 0755); err != nil {
+		return err
+	}
+
+	tmp := j.Path + ".tmp"
+	if err = os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, j.Path)
+}
+
+func (j *multipartJournal) remove() {
+	_ = os.Remove(j.Path)
+}
+
+// journalPath returns the on-disk location of the resume journal for a given
+// upload, rooted at the configured MultipartConfig.ResumeStatePath.
+func journalPath(dir, bucket, key string) string {
+	sanitized := strings.ReplaceAll(key, string(filepath.Separator), "_")
+	return filepath.Join(dir, bucket+"-"+sanitized+".journal")
+}
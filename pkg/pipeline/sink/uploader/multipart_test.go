@@ -0,0 +1,111 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package uploader
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/livekit/egress/pkg/config"
+)
+
+func TestMultipartJournalSaveCreatesResumeDir(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "does", "not", "exist", "yet")
+	j := &multipartJournal{
+		Path:     journalPath(dir, "my-bucket", "recordings/room-1.mp4"),
+		UploadID: "upload-id",
+		Bucket:   "my-bucket",
+		Key:      "recordings/room-1.mp4",
+		PartSize: 5 << 20,
+		ETags:    map[int32]string{1: "etag-1"},
+	}
+
+	if err := j.save(); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	loaded, ok := loadMultipartJournal(j.Path)
+	if !ok {
+		t.Fatalf("loadMultipartJournal: not found at %s", j.Path)
+	}
+	if loaded.UploadID != j.UploadID {
+		t.Errorf("UploadID = %q, want %q", loaded.UploadID, j.UploadID)
+	}
+	if loaded.ETags[1] != "etag-1" {
+		t.Errorf("ETags[1] = %q, want %q", loaded.ETags[1], "etag-1")
+	}
+}
+
+func TestMultipartJournalResumeAddsParts(t *testing.T) {
+	dir := t.TempDir()
+	path := journalPath(dir, "bucket", "key")
+
+	j := &multipartJournal{Path: path, UploadID: "upload-id", PartSize: 1024, ETags: map[int32]string{}}
+	if err := j.save(); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	loaded, ok := loadMultipartJournal(path)
+	if !ok {
+		t.Fatalf("loadMultipartJournal: not found")
+	}
+	loaded.ETags[1] = "etag-1"
+	if err := loaded.save(); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	resumed, ok := loadMultipartJournal(path)
+	if !ok {
+		t.Fatalf("loadMultipartJournal: not found after resume")
+	}
+	if _, done := resumed.ETags[1]; !done {
+		t.Errorf("expected part 1 to already be recorded after resume")
+	}
+
+	resumed.remove()
+	if _, ok := loadMultipartJournal(path); ok {
+		t.Errorf("expected journal to be gone after remove")
+	}
+}
+
+func TestNormalizeMultipartConfigClampsZeroValues(t *testing.T) {
+	got := normalizeMultipartConfig(&config.MultipartConfig{})
+	if got.PartSize != minPartSize {
+		t.Errorf("PartSize = %d, want %d", got.PartSize, minPartSize)
+	}
+	if got.Threshold != defaultMultipartThreshold {
+		t.Errorf("Threshold = %d, want %d", got.Threshold, defaultMultipartThreshold)
+	}
+}
+
+func TestNormalizeMultipartConfigPreservesExplicitValues(t *testing.T) {
+	got := normalizeMultipartConfig(&config.MultipartConfig{PartSize: 10 << 20, Threshold: 1 << 20})
+	if got.PartSize != 10<<20 {
+		t.Errorf("PartSize = %d, want %d", got.PartSize, 10<<20)
+	}
+	if got.Threshold != 1<<20 {
+		t.Errorf("Threshold = %d, want %d", got.Threshold, 1<<20)
+	}
+}
+
+func TestJournalPathSanitizesSeparators(t *testing.T) {
+	path := journalPath("/tmp/state", "bucket", "recordings/room-1.mp4")
+	if filepath.Dir(path) != "/tmp/state" {
+		t.Errorf("dir = %q, want %q", filepath.Dir(path), "/tmp/state")
+	}
+	if filepath.Base(path) == "bucket-recordings/room-1.mp4.journal" {
+		t.Errorf("journal path was not sanitized: %q", path)
+	}
+}
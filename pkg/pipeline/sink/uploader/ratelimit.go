@@ -0,0 +1,73 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package uploader
+
+import (
+	"context"
+	"io"
+
+	"golang.org/x/time/rate"
+)
+
+// tokenBucket rate limits upload bandwidth to a configured bytes/sec
+// ceiling, shared across every in-flight upload in the process.
+type tokenBucket struct {
+	limiter *rate.Limiter
+}
+
+func newTokenBucket(bytesPerSecond int) *tokenBucket {
+	return &tokenBucket{limiter: rate.NewLimiter(rate.Limit(bytesPerSecond), bytesPerSecond)}
+}
+
+// waitN blocks until n bytes' worth of bandwidth budget is available. n may
+// exceed the limiter's burst (e.g. a whole multipart part read into memory
+// at once) — rate.Limiter.WaitN errors immediately if asked to wait for more
+// than its burst in one call, so waitN chunks the request into burst-sized
+// pieces instead of handing n straight through.
+func (b *tokenBucket) waitN(ctx context.Context, n int) error {
+	burst := b.limiter.Burst()
+	for n > 0 {
+		chunk := n
+		if chunk > burst {
+			chunk = burst
+		}
+		if err := b.limiter.WaitN(ctx, chunk); err != nil {
+			return err
+		}
+		n -= chunk
+	}
+	return nil
+}
+
+func (b *tokenBucket) reader(r io.Reader) io.Reader {
+	return &limitedReader{r: r, bucket: b}
+}
+
+// limitedReader wraps a file handle so that reading from it, and therefore
+// uploading it, can't exceed the configured bandwidth limit.
+type limitedReader struct {
+	r      io.Reader
+	bucket *tokenBucket
+}
+
+func (lr *limitedReader) Read(p []byte) (int, error) {
+	n, err := lr.r.Read(p)
+	if n > 0 {
+		if waitErr := lr.bucket.waitN(context.Background(), n); waitErr != nil && err == nil {
+			err = waitErr
+		}
+	}
+	return n, err
+}
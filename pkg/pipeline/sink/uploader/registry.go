@@ -0,0 +1,80 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package uploader
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/livekit/egress/pkg/config"
+)
+
+// Factory builds an uploader backend from a StorageConfig.
+type Factory func(conf *config.StorageConfig) (uploader, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]Factory)
+)
+
+// Register makes an uploader backend available under name, so that
+// getUploader can resolve config.StorageConfig.Backend without a hard-coded
+// switch. It's meant to be called from the init() of the file implementing
+// the backend; registering the same name twice is always a programming
+// error, so Register panics rather than returning it.
+func Register(name string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if _, ok := registry[name]; ok {
+		panic(fmt.Sprintf("uploader: backend %q already registered", name))
+	}
+	registry[name] = factory
+}
+
+func lookup(name string) (Factory, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	factory, ok := registry[name]
+	return factory, ok
+}
+
+func init() {
+	Register("s3", newS3Uploader)
+	Register("gcp", newGCPUploader)
+	Register("azure", newAzureUploader)
+	Register("alioss", newAliOSSUploader)
+	Register("sftp", newSFTPUploader)
+	Register("webdav", newWebDAVUploader)
+	Register("local", newLocalUploader)
+}
+
+// legacyBackendName infers the backend name from which storage-specific
+// config block is set, for configs written before Backend existed.
+func legacyBackendName(conf *config.StorageConfig) string {
+	switch {
+	case conf.S3 != nil:
+		return "s3"
+	case conf.GCP != nil:
+		return "gcp"
+	case conf.Azure != nil:
+		return "azure"
+	case conf.AliOSS != nil:
+		return "alioss"
+	default:
+		return "local"
+	}
+}
@@ -0,0 +1,281 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package uploader
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/egress/pkg/types"
+	"github.com/livekit/protocol/logger"
+	"github.com/livekit/psrpc"
+)
+
+type s3Uploader struct {
+	conf   *config.StorageConfig
+	client *s3.Client
+}
+
+func newS3Uploader(conf *config.StorageConfig) (uploader, error) {
+	c := conf.S3
+
+	opts := []func(*awsconfig.LoadOptions) error{
+		awsconfig.WithRegion(c.Region),
+	}
+	if c.AccessKey != "" && c.Secret != "" {
+		opts = append(opts, awsconfig.WithCredentialsProvider(
+			credentials.NewStaticCredentialsProvider(c.AccessKey, c.Secret, c.SessionToken),
+		))
+	}
+
+	awsConf, err := awsconfig.LoadDefaultConfig(context.Background(), opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	client := s3.NewFromConfig(awsConf, func(o *s3.Options) {
+		if c.Endpoint != "" {
+			o.BaseEndpoint = aws.String(c.Endpoint)
+		}
+		o.UsePathStyle = c.ForcePathStyle
+	})
+
+	return &s3Uploader{conf: conf, client: client}, nil
+}
+
+func (u *s3Uploader) upload(localFilepath, storageFilepath string, _ types.OutputType) (string, int64, string, error) {
+	stat, err := os.Stat(localFilepath)
+	if err != nil {
+		return "", 0, "", err
+	}
+
+	bucket := u.conf.S3.Bucket
+	mpConf := u.conf.Multipart
+	if mpConf != nil {
+		mpConf = normalizeMultipartConfig(mpConf)
+	}
+
+	if mpConf != nil && stat.Size() >= mpConf.Threshold {
+		if err = u.uploadMultipart(localFilepath, bucket, storageFilepath, stat.Size(), mpConf); err != nil {
+			return "", 0, "", psrpc.NewErrorf(psrpc.Internal, "s3 multipart upload failed: %v", err)
+		}
+	} else {
+		f, err := os.Open(localFilepath)
+		if err != nil {
+			return "", 0, "", err
+		}
+		defer f.Close()
+
+		if _, err = u.client.PutObject(context.Background(), &s3.PutObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(storageFilepath),
+			Body:   rateLimited(f),
+		}); err != nil {
+			return "", 0, "", psrpc.NewErrorf(psrpc.Internal, "s3 upload failed: %v", err)
+		}
+	}
+
+	return s3Location(u.conf.S3, storageFilepath), stat.Size(), "", nil
+}
+
+// s3Location builds the object's URL honoring a custom Endpoint and
+// ForcePathStyle, the same options used to construct the client, instead of
+// always assuming the AWS-hosted virtual-hosted-style URL.
+func s3Location(c *config.S3Config, key string) string {
+	if c.Endpoint == "" {
+		if c.ForcePathStyle {
+			return fmt.Sprintf("https://s3.amazonaws.com/%s/%s", c.Bucket, key)
+		}
+		return fmt.Sprintf("https://%s.s3.amazonaws.com/%s", c.Bucket, key)
+	}
+
+	endpoint := strings.TrimRight(c.Endpoint, "/")
+	if c.ForcePathStyle {
+		return fmt.Sprintf("%s/%s/%s", endpoint, c.Bucket, key)
+	}
+
+	if u, err := url.Parse(endpoint); err == nil && u.Host != "" {
+		return fmt.Sprintf("%s://%s.%s/%s", u.Scheme, c.Bucket, u.Host, key)
+	}
+
+	return fmt.Sprintf("%s/%s/%s", endpoint, c.Bucket, key)
+}
+
+// delete removes the object at storageFilepath, the same key argument
+// passed to upload.
+func (u *s3Uploader) delete(storageFilepath string) error {
+	_, err := u.client.DeleteObject(context.Background(), &s3.DeleteObjectInput{
+		Bucket: aws.String(u.conf.S3.Bucket),
+		Key:    aws.String(storageFilepath),
+	})
+	return err
+}
+
+// uploadMultipart drives S3's low-level multipart API directly (rather than
+// the SDK's manager.Uploader) so that the upload id and completed part ETags
+// can be journaled to disk and an interrupted egress can resume the same
+// multipart upload instead of starting over.
+func (u *s3Uploader) uploadMultipart(localFilepath, bucket, key string, size int64, mpConf *config.MultipartConfig) error {
+	ctx := context.Background()
+
+	journalFile := journalPath(mpConf.ResumeStatePath, bucket, key)
+	journal, resuming := loadMultipartJournal(journalFile)
+
+	if !resuming {
+		out, err := u.client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(key),
+		})
+		if err != nil {
+			return err
+		}
+
+		journal = &multipartJournal{
+			Path:     journalFile,
+			UploadID: aws.ToString(out.UploadId),
+			Bucket:   bucket,
+			Key:      key,
+			PartSize: mpConf.PartSize,
+			ETags:    make(map[int32]string),
+		}
+		if err = journal.save(); err != nil {
+			return err
+		}
+	} else {
+		logger.Infow("resuming multipart upload", "key", key, "partsDone", len(journal.ETags))
+	}
+
+	f, err := os.Open(localFilepath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	partCount := int32((size + journal.PartSize - 1) / journal.PartSize)
+
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		uploadErr error
+	)
+	maxConcurrentParts := mpConf.MaxConcurrentParts
+	if maxConcurrentParts < 1 {
+		maxConcurrentParts = 1
+	}
+	sem := make(chan struct{}, maxConcurrentParts)
+
+	for partNum := int32(1); partNum <= partCount; partNum++ {
+		if _, done := journal.ETags[partNum]; done {
+			continue
+		}
+
+		offset := int64(partNum-1) * journal.PartSize
+		partSize := journal.PartSize
+		if offset+partSize > size {
+			partSize = size - offset
+		}
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(partNum int32, offset, partSize int64) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			buf := make([]byte, partSize)
+			if _, err := f.ReadAt(buf, offset); err != nil {
+				mu.Lock()
+				uploadErr = err
+				mu.Unlock()
+				return
+			}
+			if err := throttle(ctx, len(buf)); err != nil {
+				mu.Lock()
+				uploadErr = err
+				mu.Unlock()
+				return
+			}
+
+			out, err := u.client.UploadPart(ctx, &s3.UploadPartInput{
+				Bucket:     aws.String(bucket),
+				Key:        aws.String(key),
+				UploadId:   aws.String(journal.UploadID),
+				PartNumber: aws.Int32(partNum),
+				Body:       bytes.NewReader(buf),
+			})
+			if err != nil {
+				mu.Lock()
+				uploadErr = err
+				mu.Unlock()
+				return
+			}
+
+			mu.Lock()
+			journal.ETags[partNum] = aws.ToString(out.ETag)
+			_ = journal.save()
+			mu.Unlock()
+		}(partNum, offset, partSize)
+	}
+	wg.Wait()
+
+	if uploadErr != nil {
+		// The failure isn't a crash we can resume from later, so don't leave
+		// an incomplete multipart upload sitting in the bucket indefinitely.
+		if _, abortErr := u.client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(bucket),
+			Key:      aws.String(key),
+			UploadId: aws.String(journal.UploadID),
+		}); abortErr != nil {
+			logger.Errorw("failed to abort multipart upload", abortErr, "key", key)
+		}
+		journal.remove()
+		return uploadErr
+	}
+
+	parts := make([]s3types.CompletedPart, 0, len(journal.ETags))
+	for partNum, etag := range journal.ETags {
+		parts = append(parts, s3types.CompletedPart{
+			ETag:       aws.String(etag),
+			PartNumber: aws.Int32(partNum),
+		})
+	}
+	sort.Slice(parts, func(i, j int) bool {
+		return aws.ToInt32(parts[i].PartNumber) < aws.ToInt32(parts[j].PartNumber)
+	})
+
+	if _, err = u.client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(bucket),
+		Key:             aws.String(key),
+		UploadId:        aws.String(journal.UploadID),
+		MultipartUpload: &s3types.CompletedMultipartUpload{Parts: parts},
+	}); err != nil {
+		return err
+	}
+
+	journal.remove()
+	return nil
+}
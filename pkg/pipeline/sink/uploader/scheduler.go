@@ -0,0 +1,139 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package uploader
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/egress/pkg/stats"
+)
+
+// uploadScheduler bounds how many uploads run in parallel and caps aggregate
+// upload bandwidth, process-wide. It's shared by every Uploader in the
+// process so a burst of finished egresses can't saturate the uplink or
+// starve live streaming traffic on the same host.
+type uploadScheduler struct {
+	global     chan struct{}
+	perBackend map[string]chan struct{}
+	bandwidth  *tokenBucket
+}
+
+var (
+	schedulerMu sync.RWMutex
+	scheduler   *uploadScheduler
+)
+
+// ConfigureScheduler installs the process-wide upload scheduler. It should be
+// called once at startup, before any Uploader.Upload calls; calling it again
+// replaces the previous scheduler.
+func ConfigureScheduler(concurrency *config.UploadConcurrency, bandwidth *config.UploadBandwidthLimit) {
+	s := &uploadScheduler{
+		perBackend: make(map[string]chan struct{}),
+	}
+
+	if concurrency != nil {
+		if concurrency.Max > 0 {
+			s.global = make(chan struct{}, concurrency.Max)
+		}
+		for name, max := range concurrency.PerBackend {
+			if max > 0 {
+				s.perBackend[name] = make(chan struct{}, max)
+			}
+		}
+	}
+
+	if bandwidth != nil && bandwidth.BytesPerSecond > 0 {
+		s.bandwidth = newTokenBucket(bandwidth.BytesPerSecond)
+	}
+
+	schedulerMu.Lock()
+	scheduler = s
+	schedulerMu.Unlock()
+}
+
+func getScheduler() *uploadScheduler {
+	schedulerMu.RLock()
+	defer schedulerMu.RUnlock()
+	return scheduler
+}
+
+// acquire blocks until a slot is free for backend, recording queue depth and
+// wait time on monitor, and returns a func that releases the slot.
+func (s *uploadScheduler) acquire(backend string, monitor *stats.HandlerMonitor) func() {
+	if monitor != nil {
+		monitor.IncUploadQueueDepth()
+		defer monitor.DecUploadQueueDepth()
+	}
+
+	start := time.Now()
+
+	if s.global != nil {
+		s.global <- struct{}{}
+	}
+	if sem, ok := s.perBackend[backend]; ok {
+		sem <- struct{}{}
+	}
+
+	if monitor != nil {
+		monitor.ObserveUploadWaitTime(time.Since(start).Seconds())
+	}
+
+	return func() {
+		if s.global != nil {
+			<-s.global
+		}
+		if sem, ok := s.perBackend[backend]; ok {
+			<-sem
+		}
+	}
+}
+
+// acquireUpload reserves a scheduler slot for backend and returns the
+// release func, or a no-op if no scheduler has been configured.
+func acquireUpload(backend string, monitor *stats.HandlerMonitor) func() {
+	s := getScheduler()
+	if s == nil {
+		return func() {}
+	}
+
+	return s.acquire(backend, monitor)
+}
+
+// rateLimited wraps r so reads from it are throttled to the configured
+// bandwidth limit, or returns r unchanged if no limit is configured.
+func rateLimited(r io.Reader) io.Reader {
+	s := getScheduler()
+	if s == nil || s.bandwidth == nil {
+		return r
+	}
+
+	return s.bandwidth.reader(r)
+}
+
+// throttle blocks until n bytes' worth of bandwidth budget is available. Use
+// it where a backend already has the bytes in memory (e.g. a multipart
+// part) instead of wrapping an io.Reader.
+func throttle(ctx context.Context, n int) error {
+	s := getScheduler()
+	if s == nil || s.bandwidth == nil {
+		return nil
+	}
+
+	return s.bandwidth.waitN(ctx, n)
+}
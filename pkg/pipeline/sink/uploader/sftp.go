@@ -0,0 +1,180 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package uploader
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/egress/pkg/types"
+	"github.com/livekit/psrpc"
+)
+
+type sftpUploader struct {
+	conf *config.StorageConfig
+}
+
+func newSFTPUploader(conf *config.StorageConfig) (uploader, error) {
+	if conf.SFTP == nil {
+		return nil, psrpc.NewErrorf(psrpc.InvalidArgument, "missing sftp config")
+	}
+
+	return &sftpUploader{conf: conf}, nil
+}
+
+func (u *sftpUploader) upload(localFilepath, storageFilepath string, _ types.OutputType) (string, int64, string, error) {
+	c := u.conf.SFTP
+
+	stat, err := os.Stat(localFilepath)
+	if err != nil {
+		return "", 0, "", err
+	}
+
+	authMethods, err := sftpAuthMethods(c)
+	if err != nil {
+		return "", 0, "", err
+	}
+
+	hostKeyCallback, err := sftpHostKeyCallback(c)
+	if err != nil {
+		return "", 0, "", err
+	}
+
+	clientConf := &ssh.ClientConfig{
+		User:            c.User,
+		Auth:            authMethods,
+		HostKeyCallback: hostKeyCallback,
+	}
+
+	conn, err := ssh.Dial("tcp", fmt.Sprintf("%s:%d", c.Host, c.Port), clientConf)
+	if err != nil {
+		return "", 0, "", psrpc.NewErrorf(psrpc.Internal, "sftp dial failed: %v", err)
+	}
+	defer conn.Close()
+
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		return "", 0, "", psrpc.NewErrorf(psrpc.Internal, "sftp client failed: %v", err)
+	}
+	defer client.Close()
+
+	remotePath := path.Join(c.Path, storageFilepath)
+	if err = client.MkdirAll(path.Dir(remotePath)); err != nil {
+		return "", 0, "", psrpc.NewErrorf(psrpc.Internal, "sftp mkdir failed: %v", err)
+	}
+
+	in, err := os.Open(localFilepath)
+	if err != nil {
+		return "", 0, "", err
+	}
+	defer in.Close()
+
+	out, err := client.Create(remotePath)
+	if err != nil {
+		return "", 0, "", psrpc.NewErrorf(psrpc.Internal, "sftp create failed: %v", err)
+	}
+	defer out.Close()
+
+	if _, err = out.ReadFrom(rateLimited(in)); err != nil {
+		return "", 0, "", psrpc.NewErrorf(psrpc.Internal, "sftp upload failed: %v", err)
+	}
+
+	location := fmt.Sprintf("sftp://%s@%s:%d/%s", c.User, c.Host, c.Port, remotePath)
+	return location, stat.Size(), "", nil
+}
+
+// delete removes the file at storageFilepath, the same path argument passed
+// to upload, by re-dialing the remote host.
+func (u *sftpUploader) delete(storageFilepath string) error {
+	c := u.conf.SFTP
+
+	authMethods, err := sftpAuthMethods(c)
+	if err != nil {
+		return err
+	}
+
+	hostKeyCallback, err := sftpHostKeyCallback(c)
+	if err != nil {
+		return err
+	}
+
+	conn, err := ssh.Dial("tcp", fmt.Sprintf("%s:%d", c.Host, c.Port), &ssh.ClientConfig{
+		User:            c.User,
+		Auth:            authMethods,
+		HostKeyCallback: hostKeyCallback,
+	})
+	if err != nil {
+		return psrpc.NewErrorf(psrpc.Internal, "sftp dial failed: %v", err)
+	}
+	defer conn.Close()
+
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		return psrpc.NewErrorf(psrpc.Internal, "sftp client failed: %v", err)
+	}
+	defer client.Close()
+
+	return client.Remove(path.Join(c.Path, storageFilepath))
+}
+
+// sftpHostKeyCallback builds a HostKeyCallback that actually verifies the
+// remote host. InsecureIgnoreHostKey must be explicitly opted into; by
+// default a KnownHostsFile or HostKeyFingerprint is required.
+func sftpHostKeyCallback(c *config.SFTPConfig) (ssh.HostKeyCallback, error) {
+	switch {
+	case c.KnownHostsFile != "":
+		return knownhosts.New(c.KnownHostsFile)
+
+	case c.HostKeyFingerprint != "":
+		expected := c.HostKeyFingerprint
+		return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			if got := ssh.FingerprintSHA256(key); got != expected {
+				return fmt.Errorf("sftp: host key fingerprint mismatch for %s: got %s, want %s", hostname, got, expected)
+			}
+			return nil
+		}, nil
+
+	case c.InsecureIgnoreHostKey:
+		return ssh.InsecureIgnoreHostKey(), nil
+
+	default:
+		return nil, fmt.Errorf("sftp: one of KnownHostsFile, HostKeyFingerprint, or InsecureIgnoreHostKey must be set")
+	}
+}
+
+func sftpAuthMethods(c *config.SFTPConfig) ([]ssh.AuthMethod, error) {
+	if c.KeyFile != "" {
+		key, err := os.ReadFile(c.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		signer, err := ssh.ParsePrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+
+		return []ssh.AuthMethod{ssh.PublicKeys(signer)}, nil
+	}
+
+	return []ssh.AuthMethod{ssh.Password(c.Password)}, nil
+}
@@ -15,7 +15,9 @@
 package uploader
 
 import (
+	"crypto/ed25519"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/livekit/egress/pkg/config"
@@ -36,10 +38,17 @@ type uploader interface {
 }
 
 type Uploader struct {
-	primary    uploader
-	backup     uploader
-	backupUsed bool
-	monitor    *stats.HandlerMonitor
+	primary     uploader
+	primaryName string
+	backup      uploader
+	backupName  string
+	backupUsed  bool
+	monitor     *stats.HandlerMonitor
+
+	manifestMu     sync.Mutex
+	manifest       Manifest
+	signingKey     ed25519.PrivateKey
+	encryptionInfo *ManifestEncryption
 }
 
 func New(conf, backup *config.StorageConfig, monitor *stats.HandlerMonitor) (*Uploader, error) {
@@ -49,8 +58,13 @@ func New(conf, backup *config.StorageConfig, monitor *stats.HandlerMonitor) (*Up
 	}
 
 	u := &Uploader{
-		primary: p,
-		monitor: monitor,
+		primary:        wrapEncryption(p, conf),
+		primaryName:    backendName(conf),
+		monitor:        monitor,
+		encryptionInfo: manifestEncryptionInfo(conf),
+	}
+	if conf != nil {
+		u.signingKey = conf.SigningKey
 	}
 
 	if backup != nil {
@@ -58,28 +72,51 @@ func New(conf, backup *config.StorageConfig, monitor *stats.HandlerMonitor) (*Up
 		if err != nil {
 			logger.Errorw("failed to create backup uploader", err)
 		} else {
-			u.backup = b
+			u.backup = wrapEncryption(b, backup)
+			u.backupName = backendName(backup)
 		}
 	}
 
 	return u, nil
 }
 
+func manifestEncryptionInfo(conf *config.StorageConfig) *ManifestEncryption {
+	if conf == nil || conf.Encryption == nil {
+		return nil
+	}
+
+	return &ManifestEncryption{
+		Mode:       conf.Encryption.Mode,
+		Recipients: conf.Encryption.Recipients,
+	}
+}
+
+func backendName(conf *config.StorageConfig) string {
+	if conf == nil {
+		return "local"
+	}
+	if conf.Backend != "" {
+		return conf.Backend
+	}
+	return legacyBackendName(conf)
+}
+
 func getUploader(conf *config.StorageConfig) (uploader, error) {
-	switch {
-	case conf == nil:
-		return newLocalUploader(&config.StorageConfig{})
-	case conf.S3 != nil:
-		return newS3Uploader(conf)
-	case conf.GCP != nil:
-		return newGCPUploader(conf)
-	case conf.Azure != nil:
-		return newAzureUploader(conf)
-	case conf.AliOSS != nil:
-		return newAliOSSUploader(conf)
-	default:
-		return newLocalUploader(conf)
+	if conf == nil {
+		conf = &config.StorageConfig{}
+	}
+
+	name := conf.Backend
+	if name == "" {
+		name = legacyBackendName(conf)
+	}
+
+	factory, ok := lookup(name)
+	if !ok {
+		return nil, psrpc.NewErrorf(psrpc.InvalidArgument, "unknown upload backend %q", name)
 	}
+
+	return factory(conf)
 }
 
 func (u *Uploader) Upload(
@@ -88,15 +125,20 @@ func (u *Uploader) Upload(
 	deleteAfterUpload bool,
 ) (string, int64, string, error) {
 
+	release := acquireUpload(u.primaryName, u.monitor)
 	start := time.Now()
 	location, size, presignedUrl, primaryErr := u.primary.upload(localFilepath, storageFilepath, outputType)
 	elapsed := time.Since(start)
+	release()
 
 	if primaryErr == nil {
 		// success
 		if u.monitor != nil {
 			u.monitor.IncUploadCountSuccess(string(outputType), float64(elapsed.Milliseconds()))
 		}
+		if err := u.recordManifestEntry(localFilepath, storageFilepath, location, "primary", u.primary); err != nil {
+			logger.Errorw("failed to record manifest entry", err)
+		}
 		if deleteAfterUpload {
 			_ = os.Remove(localFilepath)
 		}
@@ -107,12 +149,17 @@ func (u *Uploader) Upload(
 		u.monitor.IncUploadCountFailure(string(outputType), float64(elapsed.Milliseconds()))
 	}
 	if u.backup != nil {
+		backupRelease := acquireUpload(u.backupName, u.monitor)
 		location, size, presignedUrl, backupErr := u.backup.upload(localFilepath, storageFilepath, outputType)
+		backupRelease()
 		if backupErr == nil {
 			u.backupUsed = true
 			if u.monitor != nil {
 				u.monitor.IncBackupStorageWrites(string(outputType))
 			}
+			if err := u.recordManifestEntry(localFilepath, storageFilepath, location, "backup", u.backup); err != nil {
+				logger.Errorw("failed to record manifest entry", err)
+			}
 			if deleteAfterUpload {
 				_ = os.Remove(localFilepath)
 			}
@@ -126,6 +173,11 @@ func (u *Uploader) Upload(
 	return "", 0, "", primaryErr
 }
 
-func (u *Uploader) ManifestRequired() bool {
-	return u.backupUsed
+// HasManifest reports whether any artifacts have been uploaded and so a
+// manifest is available to sign and upload alongside them.
+func (u *Uploader) HasManifest() bool {
+	u.manifestMu.Lock()
+	defer u.manifestMu.Unlock()
+
+	return len(u.manifest.Files) > 0
 }
@@ -0,0 +1,161 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package uploader
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/egress/pkg/types"
+	"github.com/livekit/psrpc"
+)
+
+type webDAVUploader struct {
+	conf   *config.StorageConfig
+	client *http.Client
+}
+
+func newWebDAVUploader(conf *config.StorageConfig) (uploader, error) {
+	if conf.WebDAV == nil {
+		return nil, psrpc.NewErrorf(psrpc.InvalidArgument, "missing webdav config")
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if conf.WebDAV.TLSInsecureSkipVerify {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+
+	return &webDAVUploader{
+		conf:   conf,
+		client: &http.Client{Transport: transport},
+	}, nil
+}
+
+func (u *webDAVUploader) upload(localFilepath, storageFilepath string, _ types.OutputType) (string, int64, string, error) {
+	c := u.conf.WebDAV
+
+	stat, err := os.Stat(localFilepath)
+	if err != nil {
+		return "", 0, "", err
+	}
+
+	f, err := os.Open(localFilepath)
+	if err != nil {
+		return "", 0, "", err
+	}
+	defer f.Close()
+
+	remotePath := path.Join(c.Path, storageFilepath)
+	if err = u.mkcolAll(path.Dir(remotePath)); err != nil {
+		return "", 0, "", psrpc.NewErrorf(psrpc.Internal, "webdav mkcol failed: %v", err)
+	}
+
+	remoteURL := strings.TrimRight(c.Endpoint, "/") + "/" + remotePath
+
+	req, err := http.NewRequest(http.MethodPut, remoteURL, rateLimited(f))
+	if err != nil {
+		return "", 0, "", err
+	}
+	req.ContentLength = stat.Size()
+	if c.Username != "" {
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+
+	res, err := u.client.Do(req)
+	if err != nil {
+		return "", 0, "", psrpc.NewErrorf(psrpc.Internal, "webdav upload failed: %v", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		return "", 0, "", psrpc.NewErrorf(psrpc.Internal, "webdav server returned status %d", res.StatusCode)
+	}
+
+	return remoteURL, stat.Size(), "", nil
+}
+
+// mkcolAll creates dir and every missing ancestor collection under it, the
+// WebDAV equivalent of sftp.go's client.MkdirAll. Unlike mkdir -p, MKCOL can
+// only create one collection at a time and requires its parent to already
+// exist, so each segment is created top-down; most servers (Nextcloud
+// included) return 409 Conflict on a bare PUT/MKCOL whose parent is missing.
+func (u *webDAVUploader) mkcolAll(dir string) error {
+	c := u.conf.WebDAV
+
+	dir = strings.Trim(dir, "/")
+	if dir == "" || dir == "." {
+		return nil
+	}
+
+	cur := ""
+	for _, segment := range strings.Split(dir, "/") {
+		cur += "/" + segment
+
+		req, err := http.NewRequest("MKCOL", strings.TrimRight(c.Endpoint, "/")+cur, nil)
+		if err != nil {
+			return err
+		}
+		if c.Username != "" {
+			req.SetBasicAuth(c.Username, c.Password)
+		}
+
+		res, err := u.client.Do(req)
+		if err != nil {
+			return err
+		}
+		res.Body.Close()
+
+		// 201 Created is success; 405 Method Not Allowed means the
+		// collection already exists, which is fine.
+		if res.StatusCode != http.StatusCreated && res.StatusCode != http.StatusMethodNotAllowed {
+			return fmt.Errorf("mkcol %s returned status %d", cur, res.StatusCode)
+		}
+	}
+
+	return nil
+}
+
+// delete removes the file at storageFilepath, the same path argument passed
+// to upload.
+func (u *webDAVUploader) delete(storageFilepath string) error {
+	c := u.conf.WebDAV
+
+	remoteURL := strings.TrimRight(c.Endpoint, "/") + "/" + path.Join(c.Path, storageFilepath)
+
+	req, err := http.NewRequest(http.MethodDelete, remoteURL, nil)
+	if err != nil {
+		return err
+	}
+	if c.Username != "" {
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+
+	res, err := u.client.Do(req)
+	if err != nil {
+		return psrpc.NewErrorf(psrpc.Internal, "webdav delete failed: %v", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 && res.StatusCode != http.StatusNotFound {
+		return psrpc.NewErrorf(psrpc.Internal, "webdav server returned status %d", res.StatusCode)
+	}
+
+	return nil
+}